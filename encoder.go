@@ -0,0 +1,145 @@
+package kocha
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a single structured log entry passed to an Encoder.
+type Record struct {
+	// Time is when the record was created.
+	Time time.Time
+
+	// Level is the record's severity.
+	Level Level
+
+	// Prefix is the destination logger's prefix, e.g. "[INFO] ".
+	Prefix string
+
+	// Caller is "file:line" of the call site, or "" if unknown.
+	Caller string
+
+	// Message is the formatted log message.
+	Message string
+
+	// Fields are the structured fields attached via Logger.With, or nil.
+	Fields map[string]interface{}
+}
+
+// Encoder formats a Record into the bytes written to a logger's destination.
+// The returned bytes should end with a newline.
+type Encoder interface {
+	Encode(r *Record) []byte
+}
+
+func sortedFieldKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type textEncoder struct {
+	flag int
+}
+
+// Text returns an Encoder that renders records as human-readable text.
+// flag controls whether a timestamp is rendered, using the same
+// log.Ldate/log.Ltime flags accepted by ConsoleLogger and FileLogger.
+func Text(flag int) Encoder {
+	return &textEncoder{flag: flag}
+}
+
+func (e *textEncoder) Encode(r *Record) []byte {
+	var buf bytes.Buffer
+	if e.flag&(log.Ldate|log.Ltime) != 0 {
+		buf.WriteString(r.Time.Format("2006/01/02 15:04:05"))
+		buf.WriteByte(' ')
+	}
+	if r.Caller != "" {
+		buf.WriteString(r.Caller)
+		buf.WriteString(": ")
+	}
+	buf.WriteString(r.Prefix)
+	buf.WriteString(r.Message)
+	for _, k := range sortedFieldKeys(r.Fields) {
+		fmt.Fprintf(&buf, " %s=%v", k, r.Fields[k])
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+type jsonEncoder struct{}
+
+// JSON returns an Encoder that renders records as single-line JSON objects.
+func JSON() Encoder {
+	return jsonEncoder{}
+}
+
+func (jsonEncoder) Encode(r *Record) []byte {
+	m := make(map[string]interface{}, len(r.Fields)+4)
+	for k, v := range r.Fields {
+		m[k] = v
+	}
+	m["time"] = r.Time.Format(time.RFC3339)
+	m["level"] = r.Level.String()
+	m["message"] = r.Message
+	if r.Prefix != "" {
+		m["prefix"] = strings.TrimSpace(r.Prefix)
+	}
+	if r.Caller != "" {
+		m["caller"] = r.Caller
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		b = []byte(fmt.Sprintf(`{"level":"ERROR","message":%q}`, fmt.Sprintf("kocha: encode error: %v", err)))
+	}
+	return append(b, '\n')
+}
+
+type logfmtEncoder struct{}
+
+// Logfmt returns an Encoder that renders records as logfmt key=value pairs.
+func Logfmt() Encoder {
+	return logfmtEncoder{}
+}
+
+func (logfmtEncoder) Encode(r *Record) []byte {
+	var buf bytes.Buffer
+	writePair := func(k string, v interface{}) {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%s=%s", k, logfmtValue(v))
+	}
+	writePair("time", r.Time.Format(time.RFC3339))
+	writePair("level", r.Level.String())
+	if r.Prefix != "" {
+		writePair("prefix", strings.TrimSpace(r.Prefix))
+	}
+	if r.Caller != "" {
+		writePair("caller", r.Caller)
+	}
+	writePair("msg", r.Message)
+	for _, k := range sortedFieldKeys(r.Fields) {
+		writePair(k, r.Fields[k])
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func logfmtValue(v interface{}) string {
+	s := fmt.Sprintf("%v", v)
+	if s == "" || strings.ContainsAny(s, " =\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
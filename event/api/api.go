@@ -0,0 +1,118 @@
+// Package api exposes the event package's Trigger call and its queue,
+// handler, and worker registries over HTTP/JSON, so events can be fired
+// and the event subsystem inspected from outside the process.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// QueueInfo describes one registered queue.
+type QueueInfo struct {
+	Name  string `json:"name"`
+	Depth int    `json:"depth"`
+}
+
+// WorkerStatus describes one running worker.
+type WorkerStatus struct {
+	Queue         string `json:"queue"`
+	Running       bool   `json:"running"`
+	LastError     string `json:"last_error,omitempty"`
+	JobsProcessed int    `json:"jobs_processed"`
+}
+
+// Config configures the handler returned by Handler.
+// Trigger, Queues, Handlers, and Workers are normally event.Trigger,
+// event.Queues, event.Handlers, and event.Workers; they're taken as funcs
+// here rather than depending on the event package directly, so that
+// event.ServeAPI (which wires them up) doesn't create an import cycle.
+type Config struct {
+	// Token, if non-empty, is required as a Bearer token on every
+	// request.
+	Token string
+
+	Trigger  func(name string, args ...interface{}) error
+	Queues   func() []QueueInfo
+	Handlers func() map[string]string
+	Workers  func() []WorkerStatus
+}
+
+// Handler returns an http.Handler exposing:
+//
+//	POST /events/{name}  trigger the named event, JSON body -> args
+//	GET  /queues          list registered queues with their depth
+//	GET  /handlers         list registered handler names -> queue
+//	GET  /workers          list per-worker status
+func Handler(config Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events/", config.handleTrigger)
+	mux.HandleFunc("/queues", config.handleQueues)
+	mux.HandleFunc("/handlers", config.handleHandlers)
+	mux.HandleFunc("/workers", config.handleWorkers)
+	return withAuth(config.Token, mux)
+}
+
+func withAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := "Bearer " + token
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("Authorization")
+		if len(got) != len(want) || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("kocha: event: api: missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (config Config) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("kocha: event: api: method not allowed"))
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/events/")
+	if name == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("kocha: event: api: event name required"))
+		return
+	}
+	var args []interface{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("kocha: event: api: invalid JSON body: %v", err))
+			return
+		}
+	}
+	if err := config.Trigger(name, args...); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+}
+
+func (config Config) handleQueues(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, config.Queues())
+}
+
+func (config Config) handleHandlers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, config.Handlers())
+}
+
+func (config Config) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, config.Workers())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
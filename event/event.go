@@ -20,7 +20,7 @@ var (
 	workersPerQueue   = 1
 	queues            = make(map[string]Queue)
 	handlerQueueNames = make(map[string]handlerQueueName)
-	workers           []*worker
+	workerGroups      = make(map[string]*workerGroup)
 	wg                = struct{ enqueue, dequeue sync.WaitGroup }{}
 )
 
@@ -84,35 +84,37 @@ func enqueue(queue Queue, pld payload) error {
 
 // Start starts background event workers.
 // By default, workers per queue is 1. To set the workers per queue, use
-// SetWorkersPerQueue before Start calls.
+// SetWorkersPerQueue before Start calls. To scale workers dynamically
+// between a min and max instead, use SetWorkerScaling before Start calls.
 func Start() {
 	for name, queue := range queues {
-		for i := 0; i < workersPerQueue; i++ {
-			worker := newWorker(name, queue.New(workersPerQueue), handlerQueueNames, &wg.dequeue)
-			workers = append(workers, worker)
-			go worker.start()
-		}
+		group := newWorkerGroup(name, queue)
+		workerGroups[name] = group
+		group.scaleTo(scaleMin)
+		go group.supervise()
 	}
 }
 
 // SetWorkersPerQueue sets the number of workers per queue.
-// It must be called before Start calls.
+// It must be called before Start calls. It's equivalent to calling
+// SetWorkerScaling(n, n, FixedPolicy{}).
 func SetWorkersPerQueue(n int) {
 	if n < 1 {
 		n = 1
 	}
 	workersPerQueue = n
+	SetWorkerScaling(n, n, FixedPolicy{})
 }
 
 // Stop wait for all workers to complete.
 func Stop() {
 	wg.enqueue.Wait()
 	defer func() {
-		workers = nil
+		workerGroups = make(map[string]*workerGroup)
 	}()
 	defer wg.dequeue.Wait()
-	for _, worker := range workers {
-		worker.stop()
+	for _, group := range workerGroups {
+		group.stopAll()
 	}
 }
 
@@ -0,0 +1,116 @@
+package event
+
+import (
+	"net/http"
+
+	"github.com/naoina/kocha/event/api"
+)
+
+// QueueInfo describes a registered queue, for introspection.
+type QueueInfo struct {
+	// Name is the name the queue was registered with via RegisterQueue.
+	Name string
+
+	// Depth is the queue's current pending length, or -1 if the queue
+	// doesn't implement Len() (int, error).
+	Depth int
+}
+
+// Queues returns info about every registered queue.
+func Queues() []QueueInfo {
+	infos := make([]QueueInfo, 0, len(queues))
+	for name, q := range queues {
+		depth := -1
+		if lq, ok := q.(lenQueue); ok {
+			if n, err := lq.Len(); err == nil {
+				depth = n
+			}
+		}
+		infos = append(infos, QueueInfo{Name: name, Depth: depth})
+	}
+	return infos
+}
+
+// Handlers returns the queue name that each registered handler will run
+// on, keyed by handler name.
+func Handlers() map[string]string {
+	result := make(map[string]string, len(handlerQueueNames))
+	for name, hq := range handlerQueueNames {
+		result[name] = hq.queueName
+	}
+	return result
+}
+
+// WorkerStatus describes one running worker, for introspection.
+type WorkerStatus struct {
+	// Queue is the name of the queue this worker dequeues from.
+	Queue string
+
+	// Running is whether the worker's dequeue loop is currently active.
+	Running bool
+
+	// LastError is the most recent error the worker encountered, or ""
+	// if it hasn't encountered one.
+	LastError string
+
+	// JobsProcessed is how many payloads this worker has handled
+	// successfully.
+	JobsProcessed int
+}
+
+// Workers returns the status of every worker currently running.
+func Workers() []WorkerStatus {
+	var statuses []WorkerStatus
+	for _, group := range workerGroups {
+		statuses = append(statuses, group.workerStatuses()...)
+	}
+	return statuses
+}
+
+// apiToken is the bearer token ServeAPI requires, if any. Set it with
+// SetAPIToken before calling ServeAPI.
+var apiToken string
+
+// SetAPIToken sets the bearer token that ServeAPI's control API requires
+// on every request. Leave it unset, or pass "", to run unauthenticated.
+func SetAPIToken(token string) {
+	apiToken = token
+}
+
+// ServeAPI stands up a standalone HTTP listener at addr exposing the
+// event control API (see event/api), so events can be triggered and the
+// event subsystem inspected from cron, webhooks, or an ops CLI without
+// recompiling the app.
+func ServeAPI(addr string) error {
+	handler := api.Handler(api.Config{
+		Token:    apiToken,
+		Trigger:  Trigger,
+		Queues:   apiQueues,
+		Handlers: Handlers,
+		Workers:  apiWorkers,
+	})
+	return http.ListenAndServe(addr, handler)
+}
+
+func apiQueues() []api.QueueInfo {
+	infos := Queues()
+	result := make([]api.QueueInfo, len(infos))
+	for i, info := range infos {
+		result[i] = api.QueueInfo{Name: info.Name, Depth: info.Depth}
+	}
+	return result
+}
+
+func apiWorkers() []api.WorkerStatus {
+	statuses := Workers()
+	result := make([]api.WorkerStatus, len(statuses))
+	for i, s := range statuses {
+		result[i] = api.WorkerStatus{
+			Queue:         s.Queue,
+			Running:       s.Running,
+			LastError:     s.LastError,
+			JobsProcessed: s.JobsProcessed,
+		}
+	}
+	return result
+}
@@ -0,0 +1,25 @@
+package event
+
+import "encoding/json"
+
+// payload is the wire format stored on a Queue: an event name together
+// with the arguments Trigger was called with.
+type payload struct {
+	Name string
+	Args []interface{}
+}
+
+// encode marshals the payload into data.
+func (p payload) encode(data *string) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	*data = string(b)
+	return nil
+}
+
+// decode unmarshals data into p.
+func (p *payload) decode(data string) error {
+	return json.Unmarshal([]byte(data), p)
+}
@@ -0,0 +1,217 @@
+// Package redisqueue implements event.Queue on top of Redis lists, so that
+// event.Trigger can be used across multiple kocha app processes.
+package redisqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/naoina/kocha/event"
+)
+
+// Config configures a Queue.
+type Config struct {
+	// URL is the Redis connection URL, e.g. "redis://localhost:6379/0".
+	URL string
+
+	// Prefix namespaces the Redis keys used by each queue.
+	// Defaults to "kocha:event:".
+	Prefix string
+
+	// PayloadTTL expires the processing list's timestamp bookkeeping (one
+	// hash shared by every in-flight payload of the queue) once no payload
+	// has been dequeued for this long, as a backstop against unbounded
+	// growth. Payloads still on the processing list when it expires are
+	// no longer recovered by the janitor. Defaults to 1 hour.
+	PayloadTTL time.Duration
+
+	// VisibilityTimeout is how long a payload may stay on the processing
+	// list before the janitor assumes its worker crashed and moves it
+	// back to the pending list. Defaults to 30s.
+	VisibilityTimeout time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Prefix == "" {
+		c.Prefix = "kocha:event:"
+	}
+	if c.PayloadTTL == 0 {
+		c.PayloadTTL = time.Hour
+	}
+	if c.VisibilityTimeout == 0 {
+		c.VisibilityTimeout = 30 * time.Second
+	}
+	return c
+}
+
+// queue implements event.Queue on top of Redis lists.
+// A queue constructed by New is a template: Start() calls its New(n) to
+// produce the per-worker instance that actually runs BRPOP/RPOPLPUSH.
+type queue struct {
+	name   string
+	client *redis.Client
+	config Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	last string
+}
+
+// New returns an event.Queue backed by Redis. name identifies the queue
+// and namespaces its Redis keys; config configures the connection.
+func New(name string, config Config) event.Queue {
+	config = config.withDefaults()
+	opts, err := redis.ParseURL(config.URL)
+	if err != nil {
+		panic(fmt.Errorf("kocha: redisqueue: invalid URL %q: %v", config.URL, err))
+	}
+	return &queue{
+		name:   name,
+		client: redis.NewClient(opts),
+		config: config,
+	}
+}
+
+func (q *queue) pendingKey() string    { return q.config.Prefix + q.name + ":pending" }
+func (q *queue) processingKey() string { return q.config.Prefix + q.name + ":processing" }
+func (q *queue) timesKey() string      { return q.config.Prefix + q.name + ":processing:times" }
+
+// New returns a queue bound to the same Redis client and connection pool,
+// so every worker spawned for this queue shares one connection pool. n is
+// accepted to satisfy event.Queue but otherwise unused.
+func (q *queue) New(n int) event.Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &queue{
+		name:   q.name,
+		client: q.client,
+		config: q.config,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.janitor()
+	return w
+}
+
+// Enqueue pushes data onto the pending list.
+func (q *queue) Enqueue(data string) error {
+	return q.client.LPush(context.Background(), q.pendingKey(), data).Err()
+}
+
+// Len reports the number of payloads currently pending. It satisfies the
+// optional depth-reporting interface event.QueueDepthPolicy looks for.
+func (q *queue) Len() (int, error) {
+	n, err := q.client.LLen(context.Background(), q.pendingKey()).Result()
+	return int(n), err
+}
+
+// Dequeue blocks until a payload is available, moving it atomically from
+// the pending list to the processing list so a crash between Dequeue and
+// the handler completing doesn't lose it. It returns event.ErrDone once
+// Stop has been called.
+func (q *queue) Dequeue() (data string, err error) {
+	q.ack()
+	// Cancelling q.ctx doesn't interrupt a blocking read already in
+	// flight, so BRPOPLPUSH waits at most a second at a time and q.ctx is
+	// rechecked between waits.
+	for {
+		data, err = q.client.BRPopLPush(q.ctx, q.pendingKey(), q.processingKey(), time.Second).Result()
+		if err == nil {
+			break
+		}
+		if q.ctx.Err() != nil {
+			return "", event.ErrDone
+		}
+		if err != redis.Nil {
+			return "", err
+		}
+	}
+	ctx := context.Background()
+	q.client.HSet(ctx, q.timesKey(), data, time.Now().Unix())
+	q.client.Expire(ctx, q.timesKey(), q.config.PayloadTTL)
+	q.mu.Lock()
+	q.last = data
+	q.mu.Unlock()
+	return data, nil
+}
+
+// ack removes the previously dequeued payload from the processing list,
+// acknowledging that its handler ran to completion.
+func (q *queue) ack() {
+	q.mu.Lock()
+	last := q.last
+	q.last = ""
+	q.mu.Unlock()
+	if last == "" {
+		return
+	}
+	ctx := context.Background()
+	q.client.LRem(ctx, q.processingKey(), 1, last)
+	q.client.HDel(ctx, q.timesKey(), last)
+}
+
+// Stop unblocks any pending Dequeue via context cancellation (it returns
+// event.ErrDone within about a second) and stops the janitor. It does not ack the last-dequeued payload: whoever is
+// running that payload's handler may still be using it, and acking
+// early would let a crash before the handler finishes lose it instead
+// of having the janitor recover it. Call Ack once the handler has
+// actually finished.
+func (q *queue) Stop() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	<-q.done
+}
+
+// Ack acknowledges the payload most recently returned by Dequeue,
+// removing it from the processing list. It satisfies the optional
+// interface event.worker uses to ack the final payload after Stop,
+// once the payload's handler has actually returned.
+func (q *queue) Ack() {
+	q.ack()
+}
+
+// janitor periodically recovers payloads that have been on the processing
+// list longer than VisibilityTimeout, so a crashed worker's in-flight
+// payload is picked up again after restart.
+func (q *queue) janitor() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.config.VisibilityTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			q.recoverStale()
+		}
+	}
+}
+
+func (q *queue) recoverStale() {
+	ctx := context.Background()
+	times, err := q.client.HGetAll(ctx, q.timesKey()).Result()
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-q.config.VisibilityTimeout).Unix()
+	for payload, tsStr := range times {
+		ts, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil || ts > cutoff {
+			continue
+		}
+		if q.client.LRem(ctx, q.processingKey(), 1, payload).Val() > 0 {
+			q.client.LPush(ctx, q.pendingKey(), payload)
+		}
+		q.client.HDel(ctx, q.timesKey(), payload)
+	}
+}
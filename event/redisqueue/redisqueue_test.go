@@ -0,0 +1,131 @@
+package redisqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/naoina/kocha/event"
+)
+
+func newTestQueue(t *testing.T, config Config) *queue {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	config.URL = "redis://" + mr.Addr()
+	root, ok := New("test", config).(*queue)
+	if !ok {
+		t.Fatalf("New did not return *queue")
+	}
+	return root
+}
+
+func TestQueueEnqueueDequeue(t *testing.T) {
+	root := newTestQueue(t, Config{})
+	if err := root.Enqueue("hello"); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	w := root.New(1).(*queue)
+	defer w.Stop()
+	data, err := w.Dequeue()
+	if err != nil {
+		t.Fatalf("Dequeue returned error: %v", err)
+	}
+	if data != "hello" {
+		t.Errorf("Dequeue returned %q, want %q", data, "hello")
+	}
+}
+
+func TestQueueStopUnblocksDequeue(t *testing.T) {
+	root := newTestQueue(t, Config{})
+	w := root.New(1).(*queue)
+	done := make(chan struct{})
+	var data string
+	var err error
+	go func() {
+		data, err = w.Dequeue()
+		close(done)
+	}()
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Dequeue did not unblock after Stop")
+	}
+	if err != event.ErrDone {
+		t.Errorf("Dequeue returned err %v, want event.ErrDone", err)
+	}
+	if data != "" {
+		t.Errorf("Dequeue returned data %q, want \"\"", data)
+	}
+}
+
+func TestQueueStopDoesNotAckInFlightPayload(t *testing.T) {
+	root := newTestQueue(t, Config{})
+	if err := root.Enqueue("in-flight"); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	w := root.New(1).(*queue)
+	if _, err := w.Dequeue(); err != nil {
+		t.Fatalf("Dequeue returned error: %v", err)
+	}
+	// Stop must not ack the payload its last Dequeue returned: the
+	// caller (e.g. worker.stop) may still be running that payload's
+	// handler, and acking early would defeat crash recovery.
+	w.Stop()
+
+	// w.ctx is cancelled by Stop, so query with a fresh context.
+	ctx := context.Background()
+	n, err := w.client.LLen(ctx, w.processingKey()).Result()
+	if err != nil {
+		t.Fatalf("LLen returned error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("processing list has %d items after Stop, want 1 (payload not yet acked)", n)
+	}
+
+	w.Ack()
+	n, err = w.client.LLen(ctx, w.processingKey()).Result()
+	if err != nil {
+		t.Fatalf("LLen returned error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("processing list has %d items after Ack, want 0", n)
+	}
+}
+
+func TestQueueRecoverStale(t *testing.T) {
+	root := newTestQueue(t, Config{VisibilityTimeout: time.Millisecond})
+	if err := root.Enqueue("crashed"); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	w := root.New(1).(*queue)
+	defer w.Stop()
+	if _, err := w.Dequeue(); err != nil {
+		t.Fatalf("Dequeue returned error: %v", err)
+	}
+	// simulate a crashed worker: the payload is now on the processing
+	// list and was never acked by a subsequent Dequeue/Ack.
+	time.Sleep(10 * time.Millisecond)
+	w.recoverStale()
+
+	n, err := w.client.LLen(w.ctx, w.pendingKey()).Result()
+	if err != nil {
+		t.Fatalf("LLen returned error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("pending list has %d items, want 1 after recovery", n)
+	}
+	n, err = w.client.LLen(w.ctx, w.processingKey()).Result()
+	if err != nil {
+		t.Fatalf("LLen returned error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("processing list has %d items, want 0 after recovery", n)
+	}
+}
@@ -0,0 +1,291 @@
+package event
+
+import (
+	"errors"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scaleInterval is how often a queue's worker group resamples depth and
+// memory usage to decide whether to grow or shrink.
+const scaleInterval = 5 * time.Second
+
+// lenQueue is implemented by queues that can report how many payloads are
+// currently pending. QueueDepthPolicy uses it; a queue that doesn't
+// implement it is treated as having unknown depth.
+type lenQueue interface {
+	Len() (int, error)
+}
+
+// memStats is a snapshot of process and system memory usage, sampled for
+// MemoryPolicy.
+type memStats struct {
+	rssBytes  uint64
+	freeBytes uint64
+}
+
+// ScalePolicy decides how many workers a queue's worker group should run.
+type ScalePolicy interface {
+	// desired returns the number of workers that should be running,
+	// given the current count, the queue's depth (-1 if unknown), and
+	// the latest memStats sample. The result is clamped to [min, max].
+	desired(min, max, current, depth int, mem memStats) int
+}
+
+// FixedPolicy always runs exactly min workers. It's the default, and
+// matches the behavior of SetWorkersPerQueue before autoscaling existed.
+type FixedPolicy struct{}
+
+func (FixedPolicy) desired(min, max, current, depth int, mem memStats) int {
+	return min
+}
+
+// QueueDepthPolicy scales workers toward max as queue depth grows past
+// TargetDepth, and back toward min as the queue drains.
+type QueueDepthPolicy struct {
+	// TargetDepth is the queue depth a single worker is expected to keep
+	// up with.
+	TargetDepth int
+}
+
+func (p QueueDepthPolicy) desired(min, max, current, depth int, mem memStats) int {
+	if depth < 0 || p.TargetDepth <= 0 {
+		return current
+	}
+	want := (depth + p.TargetDepth - 1) / p.TargetDepth
+	if want < min {
+		want = min
+	}
+	if want > max {
+		want = max
+	}
+	return want
+}
+
+// MemoryPolicy shrinks workers toward min when process RSS rises above
+// MaxRSSBytes or system free memory falls below MinFreeBytes, and grows
+// them toward max otherwise.
+type MemoryPolicy struct {
+	MaxRSSBytes  uint64
+	MinFreeBytes uint64
+}
+
+func (p MemoryPolicy) desired(min, max, current, depth int, mem memStats) int {
+	if p.underPressure(mem) {
+		if current > min {
+			return current - 1
+		}
+		return min
+	}
+	if current < max {
+		return current + 1
+	}
+	return current
+}
+
+func (p MemoryPolicy) underPressure(mem memStats) bool {
+	if p.MaxRSSBytes > 0 && mem.rssBytes >= p.MaxRSSBytes {
+		return true
+	}
+	if p.MinFreeBytes > 0 && mem.freeBytes > 0 && mem.freeBytes <= p.MinFreeBytes {
+		return true
+	}
+	return false
+}
+
+var (
+	scaleMin    = 1
+	scaleMax    = 1
+	scalePolicy ScalePolicy = FixedPolicy{}
+)
+
+// SetWorkerScaling replaces the fixed worker count set by
+// SetWorkersPerQueue with an autoscaler. A supervisor goroutine per queue
+// samples queue depth and process memory every few seconds and, guided by
+// policy, spawns additional workers up to max when load grows or retires
+// them down to min when it doesn't. It must be called before Start.
+func SetWorkerScaling(min, max int, policy ScalePolicy) {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	scaleMin, scaleMax = min, max
+	scalePolicy = policy
+}
+
+// workerGroup owns the dynamically-sized pool of workers for a single
+// queue, so Start/Stop/the autoscaler can grow and shrink it safely.
+type workerGroup struct {
+	name  string
+	queue Queue
+
+	mu       sync.Mutex
+	workers  []*worker
+	stopping bool
+
+	stopped chan struct{}
+}
+
+func newWorkerGroup(name string, queue Queue) *workerGroup {
+	return &workerGroup{name: name, queue: queue, stopped: make(chan struct{})}
+}
+
+func (g *workerGroup) len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.workers)
+}
+
+// spawn starts one more worker, unless the group is already being torn
+// down by stopAll. It adds to wg.dequeue itself, before launching the
+// worker's goroutine, so a concurrent Stop's wg.dequeue.Wait can never
+// return before the new worker is accounted for.
+func (g *workerGroup) spawn() {
+	g.mu.Lock()
+	if g.stopping {
+		g.mu.Unlock()
+		return
+	}
+	w := newWorker(g.name, g.queue.New(scaleMax), handlerQueueNames, &wg.dequeue)
+	wg.dequeue.Add(1)
+	g.workers = append(g.workers, w)
+	g.mu.Unlock()
+	go w.start()
+}
+
+func (g *workerGroup) retireOne() {
+	g.mu.Lock()
+	if len(g.workers) == 0 {
+		g.mu.Unlock()
+		return
+	}
+	w := g.workers[len(g.workers)-1]
+	g.workers = g.workers[:len(g.workers)-1]
+	g.mu.Unlock()
+	w.stop()
+}
+
+func (g *workerGroup) scaleTo(n int) {
+	for g.len() < n {
+		g.spawn()
+	}
+	for g.len() > n {
+		g.retireOne()
+	}
+}
+
+func (g *workerGroup) workerStatuses() []WorkerStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	statuses := make([]WorkerStatus, len(g.workers))
+	for i, w := range g.workers {
+		statuses[i] = w.status()
+	}
+	return statuses
+}
+
+func (g *workerGroup) depth() int {
+	lq, ok := g.queue.(lenQueue)
+	if !ok {
+		return -1
+	}
+	n, err := lq.Len()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// supervise periodically resizes the group according to scalePolicy,
+// until the group is stopped.
+func (g *workerGroup) supervise() {
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stopped:
+			return
+		case <-ticker.C:
+			want := scalePolicy.desired(scaleMin, scaleMax, g.len(), g.depth(), sampleMemStats())
+			if want > g.len() {
+				g.spawn()
+			} else if want < g.len() {
+				g.retireOne()
+			}
+		}
+	}
+}
+
+func (g *workerGroup) stopAll() {
+	g.mu.Lock()
+	g.stopping = true
+	workers := g.workers
+	g.workers = nil
+	g.mu.Unlock()
+	close(g.stopped)
+	for _, w := range workers {
+		w.stop()
+	}
+}
+
+// memoryPressureHigh reports whether the active MemoryPolicy (if any)
+// currently considers the process over its ceiling.
+func memoryPressureHigh() bool {
+	mp, ok := scalePolicy.(MemoryPolicy)
+	if !ok {
+		return false
+	}
+	return mp.underPressure(sampleMemStats())
+}
+
+func sampleMemStats() memStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	rss := ms.Sys
+	if v, err := processRSSBytes(); err == nil {
+		rss = v
+	}
+	free, _ := systemFreeBytes()
+	return memStats{rssBytes: rss, freeBytes: free}
+}
+
+// processRSSBytes reads this process's resident set size from
+// /proc/self/status. It only works on Linux; callers fall back to
+// runtime.MemStats.Sys elsewhere or on error.
+func processRSSBytes() (uint64, error) {
+	return parseMeminfoField("/proc/self/status", "VmRSS:")
+}
+
+// systemFreeBytes reads the system-wide available memory from
+// /proc/meminfo. It only works on Linux.
+func systemFreeBytes() (uint64, error) {
+	return parseMeminfoField("/proc/meminfo", "MemAvailable:")
+}
+
+func parseMeminfoField(path, field string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, field) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			break
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	return 0, errors.New("kocha: event: field `" + field + "' not found in " + path)
+}
@@ -0,0 +1,157 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryBackoff is how long a worker waits before rechecking memory
+// pressure while it's gated from picking up new jobs.
+const memoryBackoff = 2 * time.Second
+
+// worker dequeues payloads from a single Queue instance and dispatches
+// them to the handler registered for the payload's event name.
+type worker struct {
+	name              string
+	queue             Queue
+	handlerQueueNames map[string]handlerQueueName
+	wg                *sync.WaitGroup
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+
+	statusMu      sync.Mutex
+	running       bool
+	lastErr       error
+	jobsProcessed int
+}
+
+func newWorker(name string, queue Queue, handlerQueueNames map[string]handlerQueueName, wg *sync.WaitGroup) *worker {
+	return &worker{
+		name:              name,
+		queue:             queue,
+		handlerQueueNames: handlerQueueNames,
+		wg:                wg,
+		stopCh:            make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+}
+
+// start runs the dequeue loop until stop is called or the queue returns
+// ErrDone. While memory pressure is high it stops picking up new jobs so
+// it drains cleanly instead of terminating mid-job.
+// The caller must have already added to w.wg before launching start as a
+// goroutine, so wg.Wait can't return before this worker is accounted for.
+func (w *worker) start() {
+	defer w.wg.Done()
+	defer close(w.done)
+	w.setRunning(true)
+	defer w.setRunning(false)
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		default:
+		}
+		if memoryPressureHigh() {
+			select {
+			case <-w.stopCh:
+				return
+			case <-time.After(memoryBackoff):
+			}
+			continue
+		}
+		data, err := w.queue.Dequeue()
+		if err != nil {
+			if err == ErrDone {
+				return
+			}
+			ErrorHandler(err)
+			continue
+		}
+		w.process(data)
+	}
+}
+
+func (w *worker) process(data string) {
+	defer func() {
+		if err := recover(); err != nil {
+			w.setLastErr(fmt.Errorf("%v", err))
+			ErrorHandler(err)
+		}
+	}()
+	var pld payload
+	if err := pld.decode(data); err != nil {
+		w.setLastErr(err)
+		ErrorHandler(err)
+		return
+	}
+	hq, exist := w.handlerQueueNames[pld.Name]
+	if !exist {
+		w.setLastErr(ErrNotExist)
+		ErrorHandler(ErrNotExist)
+		return
+	}
+	if err := hq.handler(pld.Args...); err != nil {
+		w.setLastErr(err)
+		ErrorHandler(err)
+		return
+	}
+	w.statusMu.Lock()
+	w.jobsProcessed++
+	w.statusMu.Unlock()
+}
+
+func (w *worker) setRunning(running bool) {
+	w.statusMu.Lock()
+	w.running = running
+	w.statusMu.Unlock()
+}
+
+func (w *worker) setLastErr(err error) {
+	w.statusMu.Lock()
+	w.lastErr = err
+	w.statusMu.Unlock()
+}
+
+// status returns a snapshot of the worker's current state, for the
+// event/api subpackage.
+func (w *worker) status() WorkerStatus {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	lastErr := ""
+	if w.lastErr != nil {
+		lastErr = w.lastErr.Error()
+	}
+	return WorkerStatus{
+		Queue:         w.name,
+		Running:       w.running,
+		LastError:     lastErr,
+		JobsProcessed: w.jobsProcessed,
+	}
+}
+
+// acker is implemented by queues that defer acking their last-dequeued
+// payload until after its handler has finished, rather than acking it
+// as soon as Stop unblocks Dequeue. redisqueue.queue is one.
+type acker interface {
+	Ack()
+}
+
+// stop tells the worker to stop picking up new jobs, unblocks a pending
+// Dequeue via the queue's own Stop, and waits for start to return. Only
+// once start has returned — so any in-flight process call has actually
+// finished — does it ack the last-dequeued payload, if the queue
+// supports that.
+func (w *worker) stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+		w.queue.Stop()
+	})
+	<-w.done
+	if a, ok := w.queue.(acker); ok {
+		a.Ack()
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"go/build"
 	"io/ioutil"
@@ -14,99 +13,95 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/spf13/cobra"
+
 	"github.com/naoina/kocha"
 	"github.com/naoina/kocha/util"
 )
 
-// buildCommand implements `command` interface for `build` command.
-type buildCommand struct {
-	flag *flag.FlagSet
-
-	// Whether the build as the True All-in-One binary.
+// buildOptions holds the flags accepted by the build command.
+type buildOptions struct {
+	// all is whether to build the true all-in-one binary.
 	all bool
 
-	// Version tag
+	// versionTag is an explicit version tag, overriding auto-detection.
 	versionTag string
 }
 
-// Name returns name of `build` command.
-func (c *buildCommand) Name() string {
-	return "build"
-}
-
-// Alias returns alias of `build` command.
-func (c *buildCommand) Alias() string {
-	return "b"
-}
-
-// Short returns short description for help.
-func (c *buildCommand) Short() string {
-	return "build your application"
-}
-
-// Usage returns usage of `build` command.
-func (c *buildCommand) Usage() string {
-	return fmt.Sprintf(`%s [-a] [-tag TAG]`, c.Name())
-}
-
-func (c *buildCommand) DefineFlags(fs *flag.FlagSet) {
-	fs.BoolVar(&c.all, "a", false, "make the true all-in-one binary")
-	fs.StringVar(&c.versionTag, "tag", "", "specify version tag")
-	c.flag = fs
+// newBuildCommand returns the `build` subcommand.
+func newBuildCommand() *cobra.Command {
+	opts := &buildOptions{}
+	cmd := &cobra.Command{
+		Use:     "build",
+		Aliases: []string{"b"},
+		Short:   "build your application",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBuild(opts)
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.all, "a", "a", false, "make the true all-in-one binary")
+	cmd.Flags().StringVar(&opts.versionTag, "tag", "", "specify version tag")
+	return cmd
 }
 
-// Run execute the process for `build` command.
-func (c *buildCommand) Run() {
+// runBuild runs the `build` command. Independent configuration problems
+// are collected into a MultiError so they can all be reported together,
+// rather than aborting on the first one.
+func runBuild(opts *buildOptions) error {
+	errs := &MultiError{}
 	dir, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return err
 	}
 	appDir, err := util.FindAppDir()
 	if err != nil {
-		panic(err)
+		return err
 	}
 	appName := filepath.Base(dir)
-	configPkg, err := c.Package(path.Join(appDir, "config"))
-	if err != nil {
-		util.PanicOnError(c, "abort: cannot import `%s`: %v", path.Join(appDir, "config"), err)
-	}
+
+	configPkg, err := buildPackage(path.Join(appDir, "config"))
+	errs.Add(wrapImportErr(err, path.Join(appDir, "config")))
 	var dbImportPath string
-	dbPkg, err := c.Package(path.Join(appDir, "db"))
-	if err == nil {
+	if dbPkg, err := buildPackage(path.Join(appDir, "db")); err == nil {
 		dbImportPath = dbPkg.ImportPath
 	}
 	var migrationsImportPath string
-	migrationsPkg, err := c.Package(path.Join(appDir, "db", "migrations"))
-	if err == nil {
+	if migrationsPkg, err := buildPackage(path.Join(appDir, "db", "migrations")); err == nil {
 		migrationsImportPath = migrationsPkg.ImportPath
 	}
+	if err := errs.ErrOrNil(); err != nil {
+		return err
+	}
+
 	tmpDir, err := filepath.Abs("tmp")
 	if err != nil {
-		panic(err)
+		return err
 	}
 	if err := os.Mkdir(tmpDir, 0755); err != nil && !os.IsExist(err) {
-		util.PanicOnError(c, "abort: failed to create directory: %v", err)
+		return fmt.Errorf("abort: failed to create directory: %v", err)
 	}
 	_, filename, _, _ := runtime.Caller(0)
 	baseDir := filepath.Dir(filename)
 	skeletonDir := filepath.Join(baseDir, "skeleton", "build")
 	mainTemplate, err := ioutil.ReadFile(filepath.Join(skeletonDir, "main.go.template"))
 	if err != nil {
-		panic(err)
+		return err
 	}
 	mainFilePath := filepath.ToSlash(filepath.Join(tmpDir, "main.go"))
 	builderFilePath := filepath.ToSlash(filepath.Join(tmpDir, "builder.go"))
 	file, err := os.Create(builderFilePath)
 	if err != nil {
-		util.PanicOnError(c, "abort: failed to create file: %v", err)
+		return fmt.Errorf("abort: failed to create file: %v", err)
 	}
 	defer file.Close()
 	builderTemplatePath := filepath.ToSlash(filepath.Join(skeletonDir, "builder.go.template"))
 	t := template.Must(template.ParseFiles(builderTemplatePath))
 	var resources map[string]string
-	if c.all {
-		resources = c.collectResourcePaths(filepath.Join(dir, kocha.StaticDir))
+	if opts.all {
+		resources = collectResourcePaths(filepath.Join(dir, kocha.StaticDir))
 	}
+	version, err := detectVersionTag(opts.versionTag)
+	errs.Add(err)
 	data := map[string]interface{}{
 		"configImportPath":     configPkg.ImportPath,
 		"dbImportPath":         dbImportPath,
@@ -114,41 +109,58 @@ func (c *buildCommand) Run() {
 		"mainTemplate":         string(mainTemplate),
 		"mainFilePath":         mainFilePath,
 		"resources":            resources,
-		"version":              c.detectVersionTag(),
+		"version":              version,
 	}
 	if err := t.Execute(file, data); err != nil {
-		util.PanicOnError(c, "abort: failed to write file: %v", err)
+		errs.Add(fmt.Errorf("abort: failed to write file: %v", err))
+	}
+	if err := errs.ErrOrNil(); err != nil {
+		return err
 	}
+
 	execName := appName
 	if runtime.GOOS == "windows" {
 		execName += ".exe"
 	}
-	c.execCmd("go", "run", builderFilePath)
-	c.execCmd("go", "build", "-o", execName, mainFilePath)
+	// go build depends on the file go run generates above it, unlike the
+	// independent problems collected into errs elsewhere in this
+	// function, so bail out immediately instead of aggregating.
+	if err := execCmd("go", "run", builderFilePath); err != nil {
+		return err
+	}
+	if err := execCmd("go", "build", "-o", execName, mainFilePath); err != nil {
+		return err
+	}
+
 	if err := os.RemoveAll(tmpDir); err != nil {
-		panic(err)
+		return err
 	}
 	printSettingEnv()
 	fmt.Printf("build all-in-one binary to %v\n", filepath.Join(dir, execName))
 	util.PrintGreen("Build successful!\n")
+	return nil
 }
 
-func (c *buildCommand) Package(importPath string) (*build.Package, error) {
-	pkg, err := build.Import(importPath, "", build.FindOnly)
-	if err != nil {
-		return nil, err
+func wrapImportErr(err error, importPath string) error {
+	if err == nil {
+		return nil
 	}
-	return pkg, nil
+	return fmt.Errorf("abort: cannot import `%s`: %v", importPath, err)
+}
+
+func buildPackage(importPath string) (*build.Package, error) {
+	return build.Import(importPath, "", build.FindOnly)
 }
 
-func (c *buildCommand) execCmd(cmd string, args ...string) {
+func execCmd(cmd string, args ...string) error {
 	command := exec.Command(cmd, args...)
 	if msg, err := command.CombinedOutput(); err != nil {
-		util.PanicOnError(c, "abort: build failed: %v\n%v", err, string(msg))
+		return fmt.Errorf("abort: build failed: %v\n%v", err, string(msg))
 	}
+	return nil
 }
 
-func (c *buildCommand) collectResourcePaths(root string) map[string]string {
+func collectResourcePaths(root string) map[string]string {
 	result := make(map[string]string)
 	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -173,9 +185,11 @@ func (c *buildCommand) collectResourcePaths(root string) map[string]string {
 	return result
 }
 
-func (c *buildCommand) detectVersionTag() string {
-	if c.versionTag != "" {
-		return c.versionTag
+// detectVersionTag returns versionTag if set, or else tries to detect one
+// from the current git/hg repository, falling back to the current time.
+func detectVersionTag(versionTag string) (string, error) {
+	if versionTag != "" {
+		return versionTag, nil
 	}
 	var repo string
 	for _, dir := range []string{".git", ".hg"} {
@@ -189,30 +203,29 @@ func (c *buildCommand) detectVersionTag() string {
 	case ".git":
 		bin, err := exec.LookPath("git")
 		if err != nil {
-			fmt.Println("WARNING: git repository found, but `git` command not found. version uses \"%s\"", version)
+			fmt.Printf("WARNING: git repository found, but `git` command not found. version uses \"%s\"\n", version)
 			break
 		}
 		line, err := exec.Command(bin, "rev-parse", "HEAD").Output()
 		if err != nil {
-			util.PanicOnError(c, "abort: unexpected error: %v\nplease specify version explicitly with '-tag' option for avoid the this error.", err)
+			return version, fmt.Errorf("abort: unexpected error: %v\nplease specify version explicitly with '-tag' option for avoid the this error.", err)
 		}
 		version = strings.TrimSpace(string(line))
 	case ".hg":
 		bin, err := exec.LookPath("hg")
 		if err != nil {
-			fmt.Println("WARNING: hg repository found, but `hg` command not found. version uses \"%s\"", version)
+			fmt.Printf("WARNING: hg repository found, but `hg` command not found. version uses \"%s\"\n", version)
 			break
 		}
 		line, err := exec.Command(bin, "identify").Output()
 		if err != nil {
-			util.PanicOnError(c, "abort: unexpected error: %v\nplease specify version explicitly with '-tag' option for avoid the this error.", err)
+			return version, fmt.Errorf("abort: unexpected error: %v\nplease specify version explicitly with '-tag' option for avoid the this error.", err)
 		}
 		version = strings.TrimSpace(string(line))
 	}
 	if version == "" {
-		// Probably doesn't reach here.
 		version = time.Now().Format(time.RFC1123Z)
-		fmt.Println("WARNING: version is empty, use \"%s\"", version)
+		fmt.Printf("WARNING: version is empty, use \"%s\"\n", version)
 	}
-	return version
+	return version, nil
 }
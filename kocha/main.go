@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	root := newRootCommand()
+	root.SetArgs(normalizeLongFlags(os.Args[1:]))
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// legacyLongFlags are flags that predate the switch to cobra/pflag and
+// were documented and used as single-dash long flags (e.g. "-tag").
+// pflag parses a multi-character single-dash argument as a cluster of
+// shorthand flags, not a long flag, so without this rewrite "-tag foo"
+// would fail with "unknown shorthand flag" instead of setting tag.
+var legacyLongFlags = map[string]bool{
+	"-tag": true,
+}
+
+// normalizeLongFlags rewrites args so legacy single-dash long flags keep
+// working as "--"-prefixed long flags under pflag.
+func normalizeLongFlags(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		name := arg
+		if idx := strings.IndexByte(arg, '='); idx >= 0 {
+			name = arg[:idx]
+		}
+		if legacyLongFlags[name] {
+			arg = "-" + arg
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// newRootCommand builds the `kocha` command tree.
+// SilenceUsage/SilenceErrors are set so that a failing subcommand prints
+// its (possibly aggregated, see MultiError) error exactly once, here,
+// instead of cobra also dumping usage on top of it.
+//
+// run, generate, and migrate aren't ported to cobra yet (this snapshot
+// never had a working implementation of them to port), so they're left
+// off the tree rather than registered as commands that always fail.
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "kocha",
+		Short:         "kocha is a full-stack web application framework for Go",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.AddCommand(newBuildCommand())
+	return root
+}
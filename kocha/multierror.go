@@ -0,0 +1,36 @@
+package main
+
+import "strings"
+
+// MultiError collects zero or more errors encountered while running a
+// command, so every problem can be reported in one pass instead of
+// aborting on the first one.
+type MultiError struct {
+	Errors []error
+}
+
+// Error implements error, joining every collected error onto its own line.
+func (m *MultiError) Error() string {
+	msgs := make([]string, len(m.Errors))
+	for i, err := range m.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Add appends err to m if err is non-nil.
+func (m *MultiError) Add(err error) {
+	if err == nil {
+		return
+	}
+	m.Errors = append(m.Errors, err)
+}
+
+// ErrOrNil returns m if it has collected any errors, or nil otherwise, so
+// it can be returned directly from a RunE.
+func (m *MultiError) ErrOrNil() error {
+	if len(m.Errors) == 0 {
+		return nil
+	}
+	return m
+}
@@ -2,16 +2,51 @@ package kocha
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
 )
 
 const (
 	defaultLflag = log.Ldate | log.Ltime
 )
 
+// Level represents the severity of a log record.
+// Lower levels are less severe: DEBUG < INFO < WARN < ERROR < FATAL.
+type Level int
+
+// Log levels, ordered by severity.
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+	FATAL
+)
+
+// String returns the name of the level.
+func (lv Level) String() string {
+	switch lv {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	case FATAL:
+		return "FATAL"
+	default:
+		return fmt.Sprintf("Level(%d)", int(lv))
+	}
+}
+
 func initLogger(logger *Logger) *Logger {
 	if logger == nil {
 		logger = &Logger{}
@@ -44,49 +79,107 @@ func initLogger(logger *Logger) *Logger {
 type logger interface {
 	Output(calldepth int, s string) error
 	SetPrefix(prefix string)
+	Prefix() string
 	GoString() string
+	encoder() Encoder
+}
+
+// pickEncoder returns the first non-nil encoder in encoders, or def if none given.
+func pickEncoder(encoders []Encoder, def Encoder) Encoder {
+	if len(encoders) > 0 && encoders[0] != nil {
+		return encoders[0]
+	}
+	return def
 }
 
 type nullLogger struct {
 	*log.Logger
+	enc Encoder
 }
 
 func (l *nullLogger) GoString() string {
 	return "kocha.NullLogger()"
 }
 
+func (l *nullLogger) encoder() Encoder {
+	return l.enc
+}
+
+// Output discards s. It exists only to satisfy the logger interface.
+func (l *nullLogger) Output(calldepth int, s string) error {
+	return nil
+}
+
 // NullLogger returns a new null logger.
-func NullLogger() logger {
-	return &nullLogger{log.New(ioutil.Discard, "", 0)}
+// encoder is optional and defaults to Text; it has no effect since the
+// output is always discarded.
+func NullLogger(encoder ...Encoder) logger {
+	return &nullLogger{log.New(ioutil.Discard, "", 0), pickEncoder(encoder, Text(defaultLflag))}
 }
 
 type consoleLogger struct {
 	*log.Logger
+	enc Encoder
+	w   io.Writer
+	mu  sync.Mutex
 }
 
 func (l *consoleLogger) GoString() string {
 	return fmt.Sprintf("kocha.ConsoleLogger(%d)", l.Flags())
 }
 
+func (l *consoleLogger) encoder() Encoder {
+	return l.enc
+}
+
+func (l *consoleLogger) Output(calldepth int, s string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := io.WriteString(l.w, s)
+	return err
+}
+
 // ConsoleLogger returns a new console logger.
-func ConsoleLogger(flag int) logger {
+// encoder is optional and defaults to Text, which honors flag to decide
+// whether to render a timestamp.
+func ConsoleLogger(flag int, encoder ...Encoder) logger {
 	if flag == -1 {
 		flag = defaultLflag
 	}
-	return &consoleLogger{log.New(os.Stdout, "", flag)}
+	return &consoleLogger{
+		Logger: log.New(ioutil.Discard, "", flag),
+		enc:    pickEncoder(encoder, Text(flag)),
+		w:      os.Stdout,
+	}
 }
 
 type fileLogger struct {
 	*log.Logger
+	enc  Encoder
 	path string
+	file *os.File
+	mu   sync.Mutex
 }
 
 func (l *fileLogger) GoString() string {
 	return fmt.Sprintf("kocha.FileLogger(%q, %d)", l.path, l.Flags())
 }
 
+func (l *fileLogger) encoder() Encoder {
+	return l.enc
+}
+
+func (l *fileLogger) Output(calldepth int, s string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := io.WriteString(l.file, s)
+	return err
+}
+
 // FileLogger returns a new file logger that writes to path.
-func FileLogger(path string, flag int) logger {
+// encoder is optional and defaults to Text, which honors flag to decide
+// whether to render a timestamp.
+func FileLogger(path string, flag int, encoder ...Encoder) logger {
 	if flag == -1 {
 		flag = defaultLflag
 	}
@@ -101,7 +194,12 @@ func FileLogger(path string, flag int) logger {
 	if err != nil {
 		panic(err)
 	}
-	return &fileLogger{log.New(file, "", flag), path}
+	return &fileLogger{
+		Logger: log.New(ioutil.Discard, "", flag),
+		enc:    pickEncoder(encoder, Text(flag)),
+		path:   path,
+		file:   file,
+	}
 }
 
 type Loggers []logger
@@ -119,31 +217,102 @@ type Logger struct {
 
 	// Loggers for error.
 	ERROR Loggers
+
+	// MinLevel suppresses any record below this level. The zero value is
+	// DEBUG, so nothing is suppressed by default.
+	MinLevel Level
 }
 
 // Debug prints the log using DEBUG loggers.
 func (l *Logger) Debug(format string, v ...interface{}) {
-	l.output(l.DEBUG, format, v...)
+	l.output(l.DEBUG, DEBUG, nil, format, v...)
 }
 
 // Info prints the log using INFO loggers.
 func (l *Logger) Info(format string, v ...interface{}) {
-	l.output(l.INFO, format, v...)
+	l.output(l.INFO, INFO, nil, format, v...)
 }
 
 // Warn prints the log using WARN loggers.
 func (l *Logger) Warn(format string, v ...interface{}) {
-	l.output(l.WARN, format, v...)
+	l.output(l.WARN, WARN, nil, format, v...)
 }
 
 // Error prints the log using ERROR loggers.
 func (l *Logger) Error(format string, v ...interface{}) {
-	l.output(l.ERROR, format, v...)
+	l.output(l.ERROR, ERROR, nil, format, v...)
+}
+
+// Fatal prints the log using ERROR loggers, then exits the process with status 1.
+func (l *Logger) Fatal(format string, v ...interface{}) {
+	l.output(l.ERROR, FATAL, nil, format, v...)
+	os.Exit(1)
+}
+
+// With returns an Entry that carries fields and will attach them to every
+// subsequent log call made through it.
+func (l *Logger) With(fields map[string]interface{}) *Entry {
+	return &Entry{logger: l, fields: fields}
+}
+
+// Entry is a Logger bound to a fixed set of structured fields.
+// Use Logger.With to create one.
+type Entry struct {
+	logger *Logger
+	fields map[string]interface{}
+}
+
+// Debug prints the log using DEBUG loggers, with the Entry's fields attached.
+func (e *Entry) Debug(msg string) {
+	e.logger.output(e.logger.DEBUG, DEBUG, e.fields, "%s", msg)
+}
+
+// Info prints the log using INFO loggers, with the Entry's fields attached.
+func (e *Entry) Info(msg string) {
+	e.logger.output(e.logger.INFO, INFO, e.fields, "%s", msg)
 }
 
-func (l *Logger) output(loggers Loggers, format string, v ...interface{}) {
-	output := fmt.Sprintf(format+"\n", v...)
+// Warn prints the log using WARN loggers, with the Entry's fields attached.
+func (e *Entry) Warn(msg string) {
+	e.logger.output(e.logger.WARN, WARN, e.fields, "%s", msg)
+}
+
+// Error prints the log using ERROR loggers, with the Entry's fields attached.
+func (e *Entry) Error(msg string) {
+	e.logger.output(e.logger.ERROR, ERROR, e.fields, "%s", msg)
+}
+
+// Fatal prints the log using ERROR loggers, with the Entry's fields attached,
+// then exits the process with status 1.
+func (e *Entry) Fatal(msg string) {
+	e.logger.output(e.logger.ERROR, FATAL, e.fields, "%s", msg)
+	os.Exit(1)
+}
+
+func (l *Logger) output(loggers Loggers, lvl Level, fields map[string]interface{}, format string, v ...interface{}) {
+	if lvl < l.MinLevel {
+		return
+	}
+	rec := &Record{
+		Time:    time.Now(),
+		Level:   lvl,
+		Caller:  callerInfo(3),
+		Message: fmt.Sprintf(format, v...),
+		Fields:  fields,
+	}
 	for _, logger := range loggers {
-		logger.Output(2, output)
+		rec.Prefix = logger.Prefix()
+		logger.Output(2, string(logger.encoder().Encode(rec)))
+	}
+}
+
+// callerInfo returns "file:line" of the stack frame skip levels above
+// callerInfo itself (skip 1 is its own caller), or "" if it can't be
+// determined.
+func callerInfo(skip int) string {
+	_, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
 	}
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
 }
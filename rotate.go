@@ -0,0 +1,233 @@
+package kocha
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RotateOptions configures RotatingFileLogger.
+type RotateOptions struct {
+	// MaxSizeBytes rotates the file once it would exceed this size.
+	// Zero disables size-based rotation.
+	MaxSizeBytes int64
+
+	// MaxAge removes rotated backups older than this duration.
+	// Zero keeps backups regardless of age.
+	MaxAge time.Duration
+
+	// MaxBackups is the maximum number of rotated backups to keep.
+	// Zero keeps every backup.
+	MaxBackups int
+
+	// Compress gzips rotated backups asynchronously.
+	Compress bool
+
+	// LocalTime uses the local time zone for backup timestamps and MaxAge
+	// comparisons instead of UTC.
+	LocalTime bool
+}
+
+type rotatingFileLogger struct {
+	*log.Logger
+	enc  Encoder
+	opts RotateOptions
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+
+	sig chan os.Signal
+}
+
+func (l *rotatingFileLogger) GoString() string {
+	return fmt.Sprintf("kocha.RotatingFileLogger(%q, %#v)", l.path, l.opts)
+}
+
+func (l *rotatingFileLogger) encoder() Encoder {
+	return l.enc
+}
+
+func (l *rotatingFileLogger) Output(calldepth int, s string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.opts.MaxSizeBytes > 0 && l.size+int64(len(s)) > l.opts.MaxSizeBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := io.WriteString(l.file, s)
+	l.size += int64(n)
+	return err
+}
+
+// RotatingFileLogger returns a new file logger that writes to path and
+// rotates it according to opts. A SIGHUP reopens the current file in
+// place, so external tools such as logrotate can rotate it too.
+func RotatingFileLogger(path string, opts RotateOptions, encoder ...Encoder) logger {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		panic(err)
+	}
+	file, size, err := openAppend(path)
+	if err != nil {
+		panic(err)
+	}
+	l := &rotatingFileLogger{
+		Logger: log.New(ioutil.Discard, "", defaultLflag),
+		enc:    pickEncoder(encoder, Text(defaultLflag)),
+		opts:   opts,
+		path:   path,
+		file:   file,
+		size:   size,
+	}
+	l.watchReopen()
+	return l
+}
+
+func openAppend(path string) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// rotate closes the current file, renames it to a timestamped backup,
+// reopens path, and prunes/compresses old backups. It must be called with
+// l.mu held.
+func (l *rotatingFileLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.%s", l.path, l.now().Format("20060102T150405.000000000"))
+	if err := os.Rename(l.path, backup); err != nil {
+		return err
+	}
+	file, size, err := openAppend(l.path)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = size
+	if l.opts.Compress {
+		go compressBackup(backup)
+	}
+	go l.prune()
+	return nil
+}
+
+func (l *rotatingFileLogger) now() time.Time {
+	if l.opts.LocalTime {
+		return time.Now()
+	}
+	return time.Now().UTC()
+}
+
+// prune removes backups beyond MaxBackups or older than MaxAge.
+func (l *rotatingFileLogger) prune() {
+	matches, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Strings(matches)
+	if l.opts.MaxBackups > 0 && len(matches) > l.opts.MaxBackups {
+		stale := matches[:len(matches)-l.opts.MaxBackups]
+		matches = matches[len(matches)-l.opts.MaxBackups:]
+		for _, m := range stale {
+			os.Remove(m)
+		}
+	}
+	if l.opts.MaxAge > 0 {
+		cutoff := l.now().Add(-l.opts.MaxAge)
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().Before(cutoff) {
+				os.Remove(m)
+			}
+		}
+	}
+}
+
+// compressBackup gzips path and removes the uncompressed original.
+func compressBackup(path string) {
+	in, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		return
+	}
+	if err := gz.Close(); err != nil {
+		return
+	}
+	os.Remove(path)
+}
+
+// watchReopen reopens the current file in place whenever the process
+// receives SIGHUP, so external logrotate-style tools keep working.
+func (l *rotatingFileLogger) watchReopen() {
+	l.sig = make(chan os.Signal, 1)
+	signal.Notify(l.sig, syscall.SIGHUP)
+	go func() {
+		for range l.sig {
+			l.reopen()
+		}
+	}()
+}
+
+// Close stops watching for SIGHUP and closes the underlying file. A
+// RotatingFileLogger must not be used after Close. It's not part of the
+// logger interface, since NullLogger/ConsoleLogger/FileLogger have
+// nothing to release; callers that need to release a RotatingFileLogger
+// specifically (tests, a reload path that replaces it) can type-assert
+// it to io.Closer.
+func (l *rotatingFileLogger) Close() error {
+	signal.Stop(l.sig)
+	close(l.sig)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+func (l *rotatingFileLogger) reopen() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, size, err := openAppend(l.path)
+	if err != nil {
+		return
+	}
+	old := l.file
+	l.file = file
+	l.size = size
+	old.Close()
+}
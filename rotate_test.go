@@ -0,0 +1,175 @@
+package kocha
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestRotatingFileLogger(t *testing.T, opts RotateOptions) (*rotatingFileLogger, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "kocha-rotate-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "app.log")
+	l := RotatingFileLogger(path, opts).(*rotatingFileLogger)
+	t.Cleanup(func() { l.Close() })
+	return l, path
+}
+
+func TestRotatingFileLoggerRotatesOnSize(t *testing.T) {
+	l, path := newTestRotatingFileLogger(t, RotateOptions{MaxSizeBytes: 10})
+	if err := l.Output(0, "0123456789"); err != nil {
+		t.Fatalf("Output returned error: %v", err)
+	}
+	if err := l.Output(0, "x"); err != nil {
+		t.Fatalf("Output returned error: %v", err)
+	}
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	data, err := ioutil.ReadFile(backups[0])
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if string(data) != "0123456789" {
+		t.Errorf("backup content = %q, want %q", string(data), "0123456789")
+	}
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if string(data) != "x" {
+		t.Errorf("current file content = %q, want %q", string(data), "x")
+	}
+}
+
+func TestRotatingFileLoggerPrunesMaxBackups(t *testing.T) {
+	l, path := newTestRotatingFileLogger(t, RotateOptions{MaxBackups: 1})
+	for i := 0; i < 3; i++ {
+		if err := l.rotate(); err != nil {
+			t.Fatalf("rotate returned error: %v", err)
+		}
+		// rotate's prune runs asynchronously; run one synchronously as
+		// well so the backups are pruned before the next rotate.
+		l.prune()
+	}
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("got %d backups, want 1 after pruning to MaxBackups", len(backups))
+	}
+}
+
+func TestRotatingFileLoggerPrunesMaxAge(t *testing.T) {
+	l, path := newTestRotatingFileLogger(t, RotateOptions{MaxAge: time.Millisecond})
+	if err := l.rotate(); err != nil {
+		t.Fatalf("rotate returned error: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	l.prune()
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("got %d backups, want 0 after pruning by MaxAge", len(backups))
+	}
+}
+
+func TestRotatingFileLoggerCompressesBackup(t *testing.T) {
+	l, path := newTestRotatingFileLogger(t, RotateOptions{Compress: true})
+	if err := l.Output(0, "hello"); err != nil {
+		t.Fatalf("Output returned error: %v", err)
+	}
+	if err := l.rotate(); err != nil {
+		t.Fatalf("rotate returned error: %v", err)
+	}
+	var gz string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		matches, err := filepath.Glob(path + ".*.gz")
+		if err != nil {
+			t.Fatalf("Glob returned error: %v", err)
+		}
+		if len(matches) == 1 {
+			gz = matches[0]
+			break
+		}
+	}
+	if gz == "" {
+		t.Fatal("backup was not compressed within timeout")
+	}
+	f, err := os.Open(gz)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader returned error: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll returned error: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("decompressed content = %q, want %q", string(data), "hello")
+	}
+	if uncompressed := gz[:len(gz)-len(".gz")]; fileExists(uncompressed) {
+		t.Errorf("uncompressed backup %q still exists", uncompressed)
+	}
+}
+
+func TestRotatingFileLoggerReopensOnSIGHUP(t *testing.T) {
+	l, path := newTestRotatingFileLogger(t, RotateOptions{})
+	if err := l.Output(0, "before"); err != nil {
+		t.Fatalf("Output returned error: %v", err)
+	}
+	oldFile := l.file
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatalf("Rename returned error: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("Kill returned error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.mu.Lock()
+		reopened := l.file != oldFile
+		l.mu.Unlock()
+		if reopened {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file was not reopened after SIGHUP within timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := l.Output(0, "after"); err != nil {
+		t.Fatalf("Output returned error: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if string(data) != "after" {
+		t.Errorf("reopened file content = %q, want %q", string(data), "after")
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}